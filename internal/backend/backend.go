@@ -0,0 +1,83 @@
+// Package backend selects and opens the 99designs/keyring backend that
+// gog-token-sync stores tokens in.
+package backend
+
+import (
+	"fmt"
+
+	"github.com/99designs/keyring"
+)
+
+// Config describes how to open gog's keyring.
+type Config struct {
+	// Name is one of "file", "keychain", "secret-service", "kwallet",
+	// "keyctl", "wincred", "pass", or "auto" to let the platform pick.
+	Name string
+
+	FileDir  string
+	Password string
+
+	// KeyctlScope and KeyctlPerm only take effect when Name is "keyctl"
+	// (or "auto" resolves to it), but Open rejects an unrecognized
+	// KeyctlScope whatever the backend.
+	KeyctlScope string
+	KeyctlPerm  uint32
+}
+
+var byName = map[string]keyring.BackendType{
+	"file":           keyring.FileBackend,
+	"keychain":       keyring.KeychainBackend,
+	"secret-service": keyring.SecretServiceBackend,
+	"kwallet":        keyring.KWalletBackend,
+	"keyctl":         keyring.KeyCtlBackend,
+	"wincred":        keyring.WinCredBackend,
+	"pass":           keyring.PassBackend,
+}
+
+// autoDetectOrder is the preference order keyring.Open tries when the
+// platform is left to auto-detect. File is last since it's the one backend
+// every platform can always fall back to.
+var autoDetectOrder = []keyring.BackendType{
+	keyring.KeychainBackend,
+	keyring.SecretServiceBackend,
+	keyring.KWalletBackend,
+	keyring.KeyCtlBackend,
+	keyring.WinCredBackend,
+	keyring.FileBackend,
+}
+
+// validKeyctlScopes are the scopes the keyctl(1) tool and Linux kernel
+// recognize for a keyring's attachment point.
+var validKeyctlScopes = map[string]bool{
+	"user":    true,
+	"session": true,
+	"process": true,
+	"thread":  true,
+}
+
+// Open resolves cfg.Name to a keyring backend and opens it.
+func Open(cfg Config) (keyring.Keyring, error) {
+	if cfg.KeyctlScope != "" && !validKeyctlScopes[cfg.KeyctlScope] {
+		return nil, fmt.Errorf("invalid --keyctl-scope %q (want user, session, process, or thread)", cfg.KeyctlScope)
+	}
+
+	kcfg := keyring.Config{
+		ServiceName:      "gog",
+		FileDir:          cfg.FileDir,
+		FilePasswordFunc: keyring.FixedStringPrompt(cfg.Password),
+		KeyCtlScope:      cfg.KeyctlScope,
+		KeyCtlPerm:       cfg.KeyctlPerm,
+	}
+
+	if cfg.Name == "" || cfg.Name == "auto" {
+		kcfg.AllowedBackends = autoDetectOrder
+		return keyring.Open(kcfg)
+	}
+
+	bt, ok := byName[cfg.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (want one of file, keychain, secret-service, kwallet, keyctl, wincred, pass, auto)", cfg.Name)
+	}
+	kcfg.AllowedBackends = []keyring.BackendType{bt}
+	return keyring.Open(kcfg)
+}
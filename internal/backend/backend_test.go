@@ -0,0 +1,15 @@
+package backend
+
+import "testing"
+
+func TestOpen_UnknownBackend(t *testing.T) {
+	if _, err := Open(Config{Name: "not-a-backend"}); err == nil {
+		t.Fatal("expected an error for an unknown --backend")
+	}
+}
+
+func TestOpen_InvalidKeyctlScope(t *testing.T) {
+	if _, err := Open(Config{Name: "keyctl", KeyctlScope: "not-a-scope"}); err == nil {
+		t.Fatal("expected an error for an invalid --keyctl-scope")
+	}
+}
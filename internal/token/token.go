@@ -0,0 +1,18 @@
+// Package token defines the payload gog-token-sync stores in the keyring.
+package token
+
+import "time"
+
+// Token is what's stored at token:default:<email>. It's marshalled to JSON
+// and then wrapped in a JWE by tokencrypt before being written, unless
+// --legacy-plain is set.
+type Token struct {
+	RefreshToken string    `json:"refresh_token"`
+	Services     []string  `json:"services,omitempty"`
+	Scopes       []string  `json:"scopes,omitempty"`
+	CreatedAt    time.Time `json:"created_at,omitempty"`
+
+	// RotatedFrom is the previous CreatedAt, carried forward by `rotate`
+	// so a token's provenance survives a refresh-token swap.
+	RotatedFrom time.Time `json:"rotated_from,omitempty"`
+}
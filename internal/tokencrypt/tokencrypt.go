@@ -0,0 +1,95 @@
+// Package tokencrypt wraps stored tokens in a password-derived JWE before
+// they are written to the keyring, so a stolen keyring file alone isn't
+// enough to recover a refresh token.
+package tokencrypt
+
+import (
+	"fmt"
+	"strings"
+
+	jose "github.com/dvsekhvalnov/jose2go"
+)
+
+// minKDFIterations is OWASP's current floor for PBKDF2-HMAC-SHA256.
+const minKDFIterations = 600_000
+
+// Config controls how Seal and Open wrap tokens.
+type Config struct {
+	Alg           string // JWE key management algorithm, e.g. "PBES2-HS256+A128KW"
+	Enc           string // JWE content encryption algorithm, e.g. "A256GCM"
+	KDFIterations int    // PBKDF2 iteration count used by the PBES2 algorithms
+	LegacyPlain   bool   // skip encryption entirely; an escape hatch during migration
+}
+
+var algByName = map[string]string{
+	"PBES2-HS256+A128KW": jose.PBES2_HS256_A128KW,
+	"PBES2-HS384+A192KW": jose.PBES2_HS384_A192KW,
+	"PBES2-HS512+A256KW": jose.PBES2_HS512_A256KW,
+}
+
+var encByName = map[string]string{
+	"A128GCM": jose.A128GCM,
+	"A192GCM": jose.A192GCM,
+	"A256GCM": jose.A256GCM,
+}
+
+// Seal encrypts payload into a compact JWE using password as the PBES2
+// key-derivation secret. If cfg.LegacyPlain is set, payload is returned
+// unchanged so existing gog installs can keep writing plaintext during
+// migration.
+func Seal(cfg Config, password string, payload []byte) (string, error) {
+	if cfg.LegacyPlain {
+		return string(payload), nil
+	}
+
+	alg, ok := algByName[cfg.Alg]
+	if !ok {
+		return "", fmt.Errorf("unknown --jwe-alg %q", cfg.Alg)
+	}
+	enc, ok := encByName[cfg.Enc]
+	if !ok {
+		return "", fmt.Errorf("unknown --jwe-enc %q", cfg.Enc)
+	}
+	if cfg.KDFIterations < minKDFIterations {
+		return "", fmt.Errorf("--kdf-iterations must be at least %d (OWASP minimum), got %d", minKDFIterations, cfg.KDFIterations)
+	}
+
+	// The PBES2 key management algorithms take the passphrase as a plain
+	// string, not a []byte - jose2go type-asserts the key internally.
+	return jose.Encrypt(string(payload), alg, enc, password, jose.Header("p2c", cfg.KDFIterations))
+}
+
+// Open reverses Seal. If token doesn't look like a compact JWE, it's
+// assumed to already be plaintext (written before encryption support
+// existed, or with --legacy-plain) and is returned unchanged.
+func Open(password, token string) ([]byte, error) {
+	if !looksLikeJWE(token) {
+		return []byte(token), nil
+	}
+
+	plaintext, _, err := jose.Decode(token, password)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting token: %w", err)
+	}
+	return []byte(plaintext), nil
+}
+
+// looksLikeJWE reports whether s has the five dot-separated base64url
+// segments of a compact JWE. Stored token JSON can contain dots (scope URLs,
+// fractional timestamps) but always contains '{' and '"', which fall outside
+// the base64url alphabet, so this is enough to distinguish the two formats
+// on read.
+func looksLikeJWE(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 5 {
+		return false
+	}
+	for _, p := range parts {
+		for _, c := range p {
+			if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
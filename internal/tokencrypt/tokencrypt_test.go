@@ -0,0 +1,89 @@
+package tokencrypt
+
+import "testing"
+
+func validConfig() Config {
+	return Config{Alg: "PBES2-HS256+A128KW", Enc: "A256GCM", KDFIterations: minKDFIterations}
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	plaintext := `{"refresh_token":"abc"}`
+
+	sealed, err := Seal(validConfig(), "hunter2", []byte(plaintext))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if !looksLikeJWE(sealed) {
+		t.Fatalf("sealed value doesn't look like a compact JWE: %q", sealed)
+	}
+
+	got, err := Open("hunter2", sealed)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if string(got) != plaintext {
+		t.Fatalf("got %q, want %q", got, plaintext)
+	}
+}
+
+func TestSeal_LegacyPlain(t *testing.T) {
+	plaintext := `{"refresh_token":"abc"}`
+
+	sealed, err := Seal(Config{LegacyPlain: true}, "hunter2", []byte(plaintext))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if sealed != plaintext {
+		t.Fatalf("expected --legacy-plain to pass the payload through unchanged, got %q", sealed)
+	}
+}
+
+func TestOpen_PlaintextPassthrough(t *testing.T) {
+	plaintext := `{"refresh_token":"abc"}`
+
+	got, err := Open("hunter2", plaintext)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if string(got) != plaintext {
+		t.Fatalf("expected a non-JWE value to pass through unchanged, got %q", got)
+	}
+}
+
+func TestOpen_WrongPassword(t *testing.T) {
+	sealed, err := Seal(validConfig(), "hunter2", []byte("secret"))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if _, err := Open("not-the-password", sealed); err == nil {
+		t.Fatal("expected an error decrypting with the wrong password")
+	}
+}
+
+func TestOpen_CorruptJWE(t *testing.T) {
+	if _, err := Open("hunter2", "a.b.c.d.e"); err == nil {
+		t.Fatal("expected an error decrypting a corrupt JWE")
+	}
+}
+
+func TestSeal_UnknownAlgOrEnc(t *testing.T) {
+	cfg := validConfig()
+	cfg.Alg = "not-an-alg"
+	if _, err := Seal(cfg, "p", []byte("x")); err == nil {
+		t.Fatal("expected an error for an unknown --jwe-alg")
+	}
+
+	cfg = validConfig()
+	cfg.Enc = "not-an-enc"
+	if _, err := Seal(cfg, "p", []byte("x")); err == nil {
+		t.Fatal("expected an error for an unknown --jwe-enc")
+	}
+}
+
+func TestSeal_KDFIterationsBelowMinimum(t *testing.T) {
+	cfg := validConfig()
+	cfg.KDFIterations = minKDFIterations - 1
+	if _, err := Seal(cfg, "p", []byte("x")); err == nil {
+		t.Fatal("expected an error for a --kdf-iterations below the OWASP minimum")
+	}
+}
@@ -0,0 +1,89 @@
+// Package tokenio reads and writes token.Token values through a keyring,
+// applying tokencrypt's JWE wrapping along the way. It's shared by every
+// gog-token-sync subcommand and by gog-token-read.
+package tokenio
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/99designs/keyring"
+
+	"github.com/mchatman/aware/internal/token"
+	"github.com/mchatman/aware/internal/tokencrypt"
+)
+
+const keyPrefix = "token:default:"
+
+// Key returns the keyring key a given account's token is stored at.
+func Key(email string) string {
+	return keyPrefix + email
+}
+
+// EmailFromKey reverses Key, reporting ok=false for keys outside our
+// namespace (the keyring may be shared with other tools).
+func EmailFromKey(key string) (email string, ok bool) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(key, keyPrefix), true
+}
+
+// Write seals tok and stores it under email's key.
+func Write(ring keyring.Keyring, crypt tokencrypt.Config, password, email string, tok token.Token) error {
+	payload, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	sealed, err := tokencrypt.Seal(crypt, password, payload)
+	if err != nil {
+		return err
+	}
+	return ring.Set(keyring.Item{Key: Key(email), Data: []byte(sealed)})
+}
+
+// Read fetches and decrypts email's token.
+func Read(ring keyring.Keyring, password, email string) (token.Token, error) {
+	item, err := ring.Get(Key(email))
+	if err != nil {
+		return token.Token{}, err
+	}
+	plaintext, err := tokencrypt.Open(password, string(item.Data))
+	if err != nil {
+		return token.Token{}, err
+	}
+	var tok token.Token
+	if err := json.Unmarshal(plaintext, &tok); err != nil {
+		return token.Token{}, err
+	}
+	return tok, nil
+}
+
+// List returns the emails with a token stored in ring.
+func List(ring keyring.Keyring) ([]string, error) {
+	keys, err := ring.Keys()
+	if err != nil {
+		return nil, err
+	}
+	var emails []string
+	for _, k := range keys {
+		if email, ok := EmailFromKey(k); ok {
+			emails = append(emails, email)
+		}
+	}
+	return emails, nil
+}
+
+// Delete removes email's token.
+func Delete(ring keyring.Keyring, email string) error {
+	return ring.Remove(Key(email))
+}
+
+// Redact keeps enough of a secret to confirm identity in a terminal or log
+// without exposing a token that could be reused.
+func Redact(s string) string {
+	if len(s) <= 8 {
+		return "***"
+	}
+	return s[:4] + "..." + s[len(s)-4:]
+}
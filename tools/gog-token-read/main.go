@@ -0,0 +1,62 @@
+// gog-token-read: Read back a token gog-token-sync wrote, decrypting it
+// if it was stored as a JWE.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mchatman/aware/internal/backend"
+	"github.com/mchatman/aware/internal/tokenio"
+)
+
+func main() {
+	email := flag.String("email", "", "Google account email")
+	password := flag.String("password", "", "Keyring password (or set GOG_KEYRING_PASSWORD)")
+	backendName := flag.String("backend", "file", "Keyring backend: file, keychain, secret-service, kwallet, keyctl, wincred, pass, or auto")
+	keyctlScope := flag.String("keyctl-scope", "", "Keyring attachment point for the keyctl backend: user, session, process, or thread")
+	keyctlPerm := flag.Uint("keyctl-perm", 0, "Permission mask (as used by keyctl setperm) for the keyctl backend")
+	flag.Parse()
+
+	if *email == "" {
+		fmt.Fprintln(os.Stderr, "Usage: gog-token-read --email user@gmail.com")
+		os.Exit(1)
+	}
+
+	keyringPassword := *password
+	if keyringPassword == "" {
+		keyringPassword = os.Getenv("GOG_KEYRING_PASSWORD")
+	}
+	if keyringPassword == "" {
+		fmt.Fprintln(os.Stderr, "Error: keyring password required (--password or GOG_KEYRING_PASSWORD)")
+		os.Exit(1)
+	}
+
+	ring, err := backend.Open(backend.Config{
+		Name:        *backendName,
+		FileDir:     os.ExpandEnv("$HOME/.config/gog"),
+		Password:    keyringPassword,
+		KeyctlScope: *keyctlScope,
+		KeyctlPerm:  uint32(*keyctlPerm),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening keyring: %v\n", err)
+		os.Exit(1)
+	}
+
+	tok, err := tokenio.Read(ring, keyringPassword, *email)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading token: %v\n", err)
+		os.Exit(1)
+	}
+
+	tok.RefreshToken = tokenio.Redact(tok.RefreshToken)
+	out, err := json.MarshalIndent(tok, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding token: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(out))
+}
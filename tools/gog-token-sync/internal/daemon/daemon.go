@@ -0,0 +1,206 @@
+// Package daemon implements the long-running sync loop: poll the Aware
+// control plane for refresh-token rotations and reconcile them into gog's
+// keyring, instead of relying on a cron-invoked one-shot binary.
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/99designs/keyring"
+
+	"github.com/mchatman/aware/internal/token"
+	"github.com/mchatman/aware/internal/tokencrypt"
+	"github.com/mchatman/aware/internal/tokenio"
+	"github.com/mchatman/aware/tools/gog-token-sync/internal/scopes"
+)
+
+// Config configures a daemon run.
+type Config struct {
+	Ring         keyring.Keyring
+	ControlPlane string        // base URL of the Aware control plane
+	Interval     time.Duration // poll interval
+	MetricsAddr  string        // address to serve /metrics on, e.g. ":9090"
+	Crypt        tokencrypt.Config
+	Password     string
+
+	// GoogleClientID and GoogleClientSecret are used to exchange each
+	// rotation's refresh token for an access token when validating scopes.
+	// Required unless SkipScopeCheck is set.
+	GoogleClientID     string
+	GoogleClientSecret string
+	SkipScopeCheck     bool
+
+	// Reload, when it fires (e.g. on SIGHUP), forces an immediate
+	// out-of-cycle poll instead of waiting for Interval to elapse.
+	Reload <-chan struct{}
+}
+
+// rotation is one <email, service-set> tuple as reported by the control
+// plane.
+type rotation struct {
+	Email        string   `json:"email"`
+	RefreshToken string   `json:"refresh_token"`
+	Services     []string `json:"services"`
+}
+
+// Run polls the control plane for rotations and reconciles them into the
+// keyring until ctx is cancelled, at which point it shuts the metrics
+// server down and returns.
+func Run(ctx context.Context, cfg Config) error {
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("daemon: Interval must be positive, got %s", cfg.Interval)
+	}
+
+	m := newMetrics()
+
+	srv := &http.Server{Addr: cfg.MetricsAddr, Handler: metricsHandler(m)}
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serveErr <- err
+		}
+	}()
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	poll(ctx, cfg, m)
+	for {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return srv.Shutdown(shutdownCtx)
+		case err := <-serveErr:
+			return fmt.Errorf("metrics server: %w", err)
+		case <-ticker.C:
+			poll(ctx, cfg, m)
+		case <-cfg.Reload:
+			log.Printf("reload requested, forcing an out-of-cycle sync")
+			poll(ctx, cfg, m)
+		}
+	}
+}
+
+func poll(ctx context.Context, cfg Config, m *metrics) {
+	rotations, err := fetchRotations(ctx, cfg.ControlPlane)
+	if err != nil {
+		log.Printf("fetching rotations: %v", err)
+		m.recordError()
+		return
+	}
+	for _, rot := range rotations {
+		if err := reconcile(ctx, cfg, rot); err != nil {
+			log.Printf("reconciling %s: %v", rot.Email, err)
+			m.recordError()
+			continue
+		}
+		m.recordSync(rot.Email)
+	}
+}
+
+func fetchRotations(ctx context.Context, controlPlane string) ([]rotation, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, controlPlane+"/api/v1/rotations", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("control plane returned %s", resp.Status)
+	}
+	var rotations []rotation
+	if err := json.NewDecoder(resp.Body).Decode(&rotations); err != nil {
+		return nil, err
+	}
+	return rotations, nil
+}
+
+// reconcile validates that a rotation's refresh token grants the scopes its
+// service list implies, then writes it as a single tokenio.Write call so a
+// failed write never leaves a half-applied token behind - the same
+// all-or-nothing guarantee the file backend gives each key via its own
+// write-temp-then-rename.
+func reconcile(ctx context.Context, cfg Config, rot rotation) error {
+	wantedScopes, err := scopes.Resolve(rot.Services)
+	if err != nil {
+		return err
+	}
+
+	if !cfg.SkipScopeCheck {
+		if cfg.GoogleClientID == "" || cfg.GoogleClientSecret == "" {
+			return fmt.Errorf("GoogleClientID and GoogleClientSecret are required to validate scopes (or set SkipScopeCheck)")
+		}
+		client := &http.Client{Timeout: 15 * time.Second}
+		granted, err := scopes.GrantedScopes(ctx, client, cfg.GoogleClientID, cfg.GoogleClientSecret, rot.RefreshToken)
+		if err != nil {
+			return err
+		}
+		if err := scopes.Validate(wantedScopes, granted); err != nil {
+			return err
+		}
+	}
+
+	return tokenio.Write(cfg.Ring, cfg.Crypt, cfg.Password, rot.Email, token.Token{
+		RefreshToken: rot.RefreshToken,
+		Services:     rot.Services,
+		Scopes:       wantedScopes,
+		CreatedAt:    time.Now().UTC(),
+	})
+}
+
+type metrics struct {
+	mu             sync.Mutex
+	tokensSynced   int64
+	syncErrors     int64
+	lastSyncByUser map[string]time.Time
+}
+
+func newMetrics() *metrics {
+	return &metrics{lastSyncByUser: make(map[string]time.Time)}
+}
+
+func (m *metrics) recordSync(email string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokensSynced++
+	m.lastSyncByUser[email] = time.Now().UTC()
+}
+
+func (m *metrics) recordError() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.syncErrors++
+}
+
+func metricsHandler(m *metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.writeTo(w)
+	})
+}
+
+func (m *metrics) writeTo(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP tokens_synced_total Tokens written to the keyring.\n")
+	fmt.Fprintf(w, "# TYPE tokens_synced_total counter\n")
+	fmt.Fprintf(w, "tokens_synced_total %d\n", m.tokensSynced)
+	fmt.Fprintf(w, "# HELP sync_errors_total Rotations that failed to reconcile.\n")
+	fmt.Fprintf(w, "# TYPE sync_errors_total counter\n")
+	fmt.Fprintf(w, "sync_errors_total %d\n", m.syncErrors)
+	fmt.Fprintf(w, "# HELP last_sync_timestamp_seconds Unix time of the last successful sync, by email.\n")
+	fmt.Fprintf(w, "# TYPE last_sync_timestamp_seconds gauge\n")
+	for email, ts := range m.lastSyncByUser {
+		fmt.Fprintf(w, "last_sync_timestamp_seconds{email=%q} %d\n", email, ts.Unix())
+	}
+}
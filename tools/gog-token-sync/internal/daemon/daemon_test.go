@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/99designs/keyring"
+
+	"github.com/mchatman/aware/internal/tokencrypt"
+	"github.com/mchatman/aware/internal/tokenio"
+)
+
+func TestRun_RejectsNonPositiveInterval(t *testing.T) {
+	err := Run(context.Background(), Config{Interval: 0})
+	if err == nil {
+		t.Fatal("expected an error for a zero Interval")
+	}
+
+	err = Run(context.Background(), Config{Interval: -time.Second})
+	if err == nil {
+		t.Fatal("expected an error for a negative Interval")
+	}
+}
+
+func TestReconcile_SkipScopeCheckWritesToken(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	cfg := Config{
+		Ring:           ring,
+		Crypt:          tokencryptLegacyPlain(),
+		Password:       "hunter2",
+		SkipScopeCheck: true,
+	}
+	rot := rotation{Email: "user@example.com", RefreshToken: "refresh-abc", Services: []string{"drive"}}
+
+	if err := reconcile(context.Background(), cfg, rot); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+
+	tok, err := tokenio.Read(ring, cfg.Password, rot.Email)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if tok.RefreshToken != rot.RefreshToken {
+		t.Fatalf("got refresh token %q, want %q", tok.RefreshToken, rot.RefreshToken)
+	}
+	if len(tok.Scopes) == 0 {
+		t.Fatal("expected reconcile to populate Scopes from the rotation's services")
+	}
+}
+
+func TestReconcile_RequiresCredentialsUnlessSkipped(t *testing.T) {
+	cfg := Config{
+		Ring:     keyring.NewArrayKeyring(nil),
+		Crypt:    tokencryptLegacyPlain(),
+		Password: "hunter2",
+	}
+	rot := rotation{Email: "user@example.com", RefreshToken: "refresh-abc", Services: []string{"gmail"}}
+
+	if err := reconcile(context.Background(), cfg, rot); err == nil {
+		t.Fatal("expected an error when scope checking is enabled but no Google credentials are configured")
+	}
+}
+
+func TestReconcile_UnknownServiceFailsBeforeWriting(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	cfg := Config{
+		Ring:           ring,
+		Crypt:          tokencryptLegacyPlain(),
+		Password:       "hunter2",
+		SkipScopeCheck: true,
+	}
+	rot := rotation{Email: "user@example.com", RefreshToken: "refresh-abc", Services: []string{"not-a-real-service"}}
+
+	if err := reconcile(context.Background(), cfg, rot); err == nil {
+		t.Fatal("expected an error for an unknown service")
+	}
+	if _, err := tokenio.Read(ring, cfg.Password, rot.Email); err == nil {
+		t.Fatal("reconcile should not have written a token after Resolve failed")
+	}
+}
+
+func tokencryptLegacyPlain() tokencrypt.Config {
+	return tokencrypt.Config{LegacyPlain: true}
+}
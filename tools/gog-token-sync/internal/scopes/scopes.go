@@ -0,0 +1,155 @@
+// Package scopes maps gog's logical service names to the Google OAuth
+// scopes they need, and checks a refresh token actually grants them before
+// gog-token-sync writes it to the keyring.
+package scopes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Catalog maps a logical service name, as used by --services, to the
+// canonical Google OAuth scope URL it needs.
+var Catalog = map[string]string{
+	"gmail":    "https://www.googleapis.com/auth/gmail.modify",
+	"calendar": "https://www.googleapis.com/auth/calendar",
+	"drive":    "https://www.googleapis.com/auth/drive",
+	"contacts": "https://www.googleapis.com/auth/contacts",
+	"docs":     "https://www.googleapis.com/auth/documents",
+	"sheets":   "https://www.googleapis.com/auth/spreadsheets",
+}
+
+// Resolve maps service names to their canonical scope URLs. An unknown
+// service name is an error, since the whole point of the registry is to
+// catch a typo'd service before it silently grants the wrong thing.
+func Resolve(services []string) ([]string, error) {
+	resolved := make([]string, 0, len(services))
+	for _, s := range services {
+		scope, ok := Catalog[s]
+		if !ok {
+			return nil, fmt.Errorf("unknown service %q (known services: %s)", s, strings.Join(knownServices(), ", "))
+		}
+		resolved = append(resolved, scope)
+	}
+	return resolved, nil
+}
+
+func knownServices() []string {
+	names := make([]string, 0, len(Catalog))
+	for name := range Catalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GrantedScopes exchanges refreshToken for an access token and asks
+// Google's tokeninfo endpoint what scopes it actually carries.
+func GrantedScopes(ctx context.Context, client *http.Client, clientID, clientSecret, refreshToken string) ([]string, error) {
+	accessToken, err := exchangeForAccessToken(ctx, client, clientID, clientSecret, refreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("exchanging refresh token: %w", err)
+	}
+
+	endpoint := "https://oauth2.googleapis.com/tokeninfo?access_token=" + url.QueryEscape(accessToken)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling tokeninfo: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var info struct {
+		Scope string `json:"scope"`
+		Error string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("decoding tokeninfo response: %w", err)
+	}
+	if info.Error != "" {
+		return nil, fmt.Errorf("tokeninfo: %s", info.Error)
+	}
+	return strings.Fields(info.Scope), nil
+}
+
+func exchangeForAccessToken(ctx context.Context, client *http.Client, clientID, clientSecret, refreshToken string) (string, error) {
+	form := url.Values{
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"refresh_token": {refreshToken},
+		"grant_type":    {"refresh_token"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://oauth2.googleapis.com/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Error != "" {
+		return "", fmt.Errorf("%s", body.Error)
+	}
+	return body.AccessToken, nil
+}
+
+// Validate compares the scopes a token should carry against what it
+// actually grants, returning an error listing what's missing and what's
+// unexpectedly extra if they don't match.
+func Validate(wanted, granted []string) error {
+	grantedSet := toSet(granted)
+	wantedSet := toSet(wanted)
+
+	var missing, extra []string
+	for _, w := range wanted {
+		if !grantedSet[w] {
+			missing = append(missing, w)
+		}
+	}
+	for _, g := range granted {
+		if !wantedSet[g] {
+			extra = append(extra, g)
+		}
+	}
+	if len(missing) == 0 && len(extra) == 0 {
+		return nil
+	}
+
+	sort.Strings(missing)
+	sort.Strings(extra)
+	msg := "token scopes don't match the requested services"
+	if len(missing) > 0 {
+		msg += fmt.Sprintf("; missing: %s", strings.Join(missing, ", "))
+	}
+	if len(extra) > 0 {
+		msg += fmt.Sprintf("; extra: %s", strings.Join(extra, ", "))
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+func toSet(items []string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, i := range items {
+		set[i] = true
+	}
+	return set
+}
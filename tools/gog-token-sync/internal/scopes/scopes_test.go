@@ -0,0 +1,51 @@
+package scopes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolve_KnownServices(t *testing.T) {
+	got, err := Resolve([]string{"gmail", "drive"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	want := []string{Catalog["gmail"], Catalog["drive"]}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestResolve_UnknownService(t *testing.T) {
+	if _, err := Resolve([]string{"not-a-real-service"}); err == nil {
+		t.Fatal("expected an error for an unknown service")
+	}
+}
+
+func TestValidate_ExactMatch(t *testing.T) {
+	granted := []string{"https://www.googleapis.com/auth/gmail.modify", "https://www.googleapis.com/auth/drive"}
+	if err := Validate(granted, granted); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestValidate_Missing(t *testing.T) {
+	wanted := []string{"a", "b"}
+	err := Validate(wanted, []string{"a"})
+	if err == nil {
+		t.Fatal("expected an error for a missing scope")
+	}
+	if !strings.Contains(err.Error(), "missing: b") {
+		t.Fatalf("error should list the missing scope, got %q", err)
+	}
+}
+
+func TestValidate_Extra(t *testing.T) {
+	err := Validate([]string{"a"}, []string{"a", "b"})
+	if err == nil {
+		t.Fatal("expected an error for an unexpectedly extra scope")
+	}
+	if !strings.Contains(err.Error(), "extra: b") {
+		t.Fatalf("error should list the extra scope, got %q", err)
+	}
+}
@@ -1,81 +1,496 @@
-// gog-token-sync: Sync Google tokens from Aware control plane to gog's keyring
+// gog-token-sync: manage the lifecycle of Google tokens in gog's keyring
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/99designs/keyring"
-)
 
-type storedToken struct {
-	RefreshToken string    `json:"refresh_token"`
-	Services     []string  `json:"services,omitempty"`
-	Scopes       []string  `json:"scopes,omitempty"`
-	CreatedAt    time.Time `json:"created_at,omitempty"`
-}
+	"github.com/mchatman/aware/internal/backend"
+	"github.com/mchatman/aware/internal/token"
+	"github.com/mchatman/aware/internal/tokencrypt"
+	"github.com/mchatman/aware/internal/tokenio"
+	"github.com/mchatman/aware/tools/gog-token-sync/internal/daemon"
+	"github.com/mchatman/aware/tools/gog-token-sync/internal/scopes"
+)
 
 func main() {
-	email := flag.String("email", "", "Google account email")
-	refreshToken := flag.String("refresh-token", "", "OAuth refresh token")
-	services := flag.String("services", "gmail,calendar,drive,contacts,docs,sheets", "Comma-separated services")
-	password := flag.String("password", "", "Keyring password (or set GOG_KEYRING_PASSWORD)")
-	flag.Parse()
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
 
-	if *email == "" || *refreshToken == "" {
-		fmt.Fprintln(os.Stderr, "Usage: gog-token-sync --email user@gmail.com --refresh-token TOKEN")
+	args := os.Args[2:]
+	switch cmd := os.Args[1]; cmd {
+	case "sync":
+		cmdSync(args)
+	case "list":
+		cmdList(args)
+	case "get":
+		cmdGet(args)
+	case "delete":
+		cmdDelete(args)
+	case "rotate":
+		cmdRotate(args)
+	case "export":
+		cmdExport(args)
+	case "-h", "--help", "help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", cmd)
+		usage()
 		os.Exit(1)
 	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage: gog-token-sync <command> [flags]
 
-	keyringPassword := *password
-	if keyringPassword == "" {
-		keyringPassword = os.Getenv("GOG_KEYRING_PASSWORD")
+Commands:
+  sync     Write a token for one account, or run as a daemon with --daemon
+  list     Enumerate accounts with a stored token
+  get      Print a stored token, with the refresh token redacted
+  delete   Remove a stored token
+  rotate   Replace a token's refresh token, preserving its history
+  export   Dump stored tokens as JSON or shell-env assignments
+
+Run "gog-token-sync <command> -h" for a command's flags.`)
+}
+
+// ringFlags are the flags every subcommand needs to open gog's keyring.
+type ringFlags struct {
+	password    *string
+	backendName *string
+	keyctlScope *string
+	keyctlPerm  *uint
+}
+
+func addRingFlags(fs *flag.FlagSet) *ringFlags {
+	return &ringFlags{
+		password:    fs.String("password", "", "Keyring password (or set GOG_KEYRING_PASSWORD)"),
+		backendName: fs.String("backend", "file", "Keyring backend: file, keychain, secret-service, kwallet, keyctl, wincred, pass, or auto"),
+		keyctlScope: fs.String("keyctl-scope", "", "Keyring attachment point for the keyctl backend: user, session, process, or thread"),
+		keyctlPerm:  fs.Uint("keyctl-perm", 0, "Permission mask (as used by keyctl setperm) for the keyctl backend"),
 	}
-	if keyringPassword == "" {
-		fmt.Fprintln(os.Stderr, "Error: keyring password required (--password or GOG_KEYRING_PASSWORD)")
-		os.Exit(1)
+}
+
+func (r *ringFlags) open() (keyring.Keyring, string, error) {
+	password := *r.password
+	if password == "" {
+		password = os.Getenv("GOG_KEYRING_PASSWORD")
+	}
+	if password == "" {
+		return nil, "", fmt.Errorf("keyring password required (--password or GOG_KEYRING_PASSWORD)")
 	}
 
-	// Open gog's keyring (file backend)
-	ring, err := keyring.Open(keyring.Config{
-		ServiceName:             "gog",
-		FileDir:                 os.ExpandEnv("$HOME/.config/gog"),
-		FilePasswordFunc:        keyring.FixedStringPrompt(keyringPassword),
-		AllowedBackends:         []keyring.BackendType{keyring.FileBackend},
+	ring, err := backend.Open(backend.Config{
+		Name:        *r.backendName,
+		FileDir:     os.ExpandEnv("$HOME/.config/gog"),
+		Password:    password,
+		KeyctlScope: *r.keyctlScope,
+		KeyctlPerm:  uint32(*r.keyctlPerm),
 	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error opening keyring: %v\n", err)
+		return nil, "", fmt.Errorf("opening keyring: %w", err)
+	}
+	return ring, password, nil
+}
+
+// cryptFlags are the flags sync/rotate need to seal a token into a JWE.
+type cryptFlags struct {
+	alg           *string
+	enc           *string
+	kdfIterations *int
+	legacyPlain   *bool
+}
+
+func addCryptFlags(fs *flag.FlagSet) *cryptFlags {
+	return &cryptFlags{
+		alg:           fs.String("jwe-alg", "PBES2-HS256+A128KW", "JWE key management algorithm used to wrap the stored token"),
+		enc:           fs.String("jwe-enc", "A256GCM", "JWE content encryption algorithm used to wrap the stored token"),
+		kdfIterations: fs.Int("kdf-iterations", 600_000, "PBKDF2 iteration count for the JWE key derivation"),
+		legacyPlain:   fs.Bool("legacy-plain", false, "Write the stored token as plaintext JSON instead of a JWE (migration escape hatch)"),
+	}
+}
+
+func (c *cryptFlags) config() tokencrypt.Config {
+	return tokencrypt.Config{
+		Alg:           *c.alg,
+		Enc:           *c.enc,
+		KDFIterations: *c.kdfIterations,
+		LegacyPlain:   *c.legacyPlain,
+	}
+}
+
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// scopeFlags are the flags sync/rotate need to validate a refresh token's
+// scopes against the services it's meant to grant access to.
+type scopeFlags struct {
+	scopesOverride *string
+	clientID       *string
+	clientSecret   *string
+	skip           *bool
+}
+
+func addScopeFlags(fs *flag.FlagSet) *scopeFlags {
+	return &scopeFlags{
+		scopesOverride: fs.String("scopes", "", "Comma-separated OAuth scope URLs to validate against, overriding the scopes implied by --services"),
+		clientID:       fs.String("google-client-id", "", "OAuth client ID used to validate scopes (or set GOG_GOOGLE_CLIENT_ID)"),
+		clientSecret:   fs.String("google-client-secret", "", "OAuth client secret used to validate scopes (or set GOG_GOOGLE_CLIENT_SECRET)"),
+		skip:           fs.Bool("skip-scope-check", false, "Skip validating that the refresh token actually grants the requested scopes (not recommended)"),
+	}
+}
+
+// resolve returns the scope URLs a token is expected to carry: sf.scopesOverride
+// verbatim if set, otherwise each service mapped through the scopes registry.
+func (sf *scopeFlags) resolve(services []string) ([]string, error) {
+	if *sf.scopesOverride != "" {
+		return splitServices(*sf.scopesOverride), nil
+	}
+	return scopes.Resolve(services)
+}
+
+// credentials resolves the Google OAuth client credentials used to
+// validate scopes, falling back to the GOG_GOOGLE_CLIENT_ID/SECRET
+// environment variables like the other secret-bearing flags in this tool.
+func (sf *scopeFlags) credentials() (clientID, clientSecret string) {
+	clientID = *sf.clientID
+	if clientID == "" {
+		clientID = os.Getenv("GOG_GOOGLE_CLIENT_ID")
+	}
+	clientSecret = *sf.clientSecret
+	if clientSecret == "" {
+		clientSecret = os.Getenv("GOG_GOOGLE_CLIENT_SECRET")
+	}
+	return clientID, clientSecret
+}
+
+// validate calls Google's tokeninfo endpoint to confirm refreshToken grants
+// exactly the wanted scopes. It's a no-op if sf.skip is set.
+func (sf *scopeFlags) validate(ctx context.Context, refreshToken string, wanted []string) error {
+	if *sf.skip {
+		return nil
+	}
+
+	clientID, clientSecret := sf.credentials()
+	if clientID == "" || clientSecret == "" {
+		return fmt.Errorf("--google-client-id and --google-client-secret are required to validate scopes (or pass --skip-scope-check)")
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	granted, err := scopes.GrantedScopes(ctx, client, clientID, clientSecret, refreshToken)
+	if err != nil {
+		return err
+	}
+	return scopes.Validate(wanted, granted)
+}
+
+func cmdSync(args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	rf := addRingFlags(fs)
+	cf := addCryptFlags(fs)
+	sf := addScopeFlags(fs)
+	email := fs.String("email", "", "Google account email")
+	refreshToken := fs.String("refresh-token", "", "OAuth refresh token")
+	services := fs.String("services", "gmail,calendar,drive,contacts,docs,sheets", "Comma-separated services")
+	daemonMode := fs.Bool("daemon", false, "Run as a long-lived process that polls the control plane instead of syncing once and exiting")
+	controlPlane := fs.String("control-plane", "", "Base URL of the Aware control plane (required with --daemon)")
+	interval := fs.Duration("interval", 15*time.Minute, "Poll interval in daemon mode")
+	metricsAddr := fs.String("metrics-addr", ":9090", "Address to serve Prometheus /metrics on in daemon mode")
+	fs.Parse(args)
+
+	ring, password, err := rf.open()
+	if err != nil {
+		fail("%v", err)
+	}
+
+	if *daemonMode {
+		if *controlPlane == "" {
+			fail("--control-plane is required with --daemon")
+		}
+		clientID, clientSecret := sf.credentials()
+		runDaemon(ring, cf.config(), password, *controlPlane, *interval, *metricsAddr, clientID, clientSecret, *sf.skip)
+		return
+	}
+
+	if *email == "" || *refreshToken == "" {
+		fmt.Fprintln(os.Stderr, "Usage: gog-token-sync sync --email user@gmail.com --refresh-token TOKEN")
 		os.Exit(1)
 	}
 
-	// Parse services
-	var serviceList []string
-	for _, s := range splitServices(*services) {
-		serviceList = append(serviceList, s)
+	serviceList := splitServices(*services)
+	wantedScopes, err := sf.resolve(serviceList)
+	if err != nil {
+		fail("%v", err)
+	}
+	if err := sf.validate(context.Background(), *refreshToken, wantedScopes); err != nil {
+		fail("%v", err)
 	}
 
-	// Build token payload
-	payload, err := json.Marshal(storedToken{
+	err = tokenio.Write(ring, cf.config(), password, *email, token.Token{
 		RefreshToken: *refreshToken,
 		Services:     serviceList,
+		Scopes:       wantedScopes,
 		CreatedAt:    time.Now().UTC(),
 	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error encoding token: %v\n", err)
+		fail("storing token: %v", err)
+	}
+	fmt.Printf("✓ Token synced for %s\n", *email)
+}
+
+// runDaemon blocks until SIGINT/SIGTERM, which cancels the daemon's context:
+// a poll already in progress runs to its end (its HTTP requests see the
+// cancellation, keyring writes are not interrupted), then the metrics server
+// gets up to the daemon's shutdown timeout before runDaemon returns. SIGHUP
+// forces an out-of-cycle poll rather than a restart.
+func runDaemon(ring keyring.Keyring, crypt tokencrypt.Config, password, controlPlane string, interval time.Duration, metricsAddr, googleClientID, googleClientSecret string, skipScopeCheck bool) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	reload := make(chan struct{}, 1)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			select {
+			case reload <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	err := daemon.Run(ctx, daemon.Config{
+		Ring:               ring,
+		ControlPlane:       controlPlane,
+		Interval:           interval,
+		MetricsAddr:        metricsAddr,
+		Crypt:              crypt,
+		Password:           password,
+		GoogleClientID:     googleClientID,
+		GoogleClientSecret: googleClientSecret,
+		SkipScopeCheck:     skipScopeCheck,
+		Reload:             reload,
+	})
+	if err != nil {
+		fail("running daemon: %v", err)
+	}
+}
+
+func cmdList(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	rf := addRingFlags(fs)
+	fs.Parse(args)
+
+	ring, _, err := rf.open()
+	if err != nil {
+		fail("%v", err)
+	}
+
+	if err := listTokens(os.Stdout, ring); err != nil {
+		fail("listing tokens: %v", err)
+	}
+}
+
+// listTokens writes the emails with a stored token to w, one per line.
+func listTokens(w io.Writer, ring keyring.Keyring) error {
+	emails, err := tokenio.List(ring)
+	if err != nil {
+		return err
+	}
+	for _, email := range emails {
+		fmt.Fprintln(w, email)
+	}
+	return nil
+}
+
+func cmdGet(args []string) {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	rf := addRingFlags(fs)
+	email := fs.String("email", "", "Google account email")
+	fs.Parse(args)
+
+	if *email == "" {
+		fmt.Fprintln(os.Stderr, "Usage: gog-token-sync get --email user@gmail.com")
 		os.Exit(1)
 	}
 
-	// Store token with gog's key format
-	key := fmt.Sprintf("token:default:%s", *email)
-	if err := ring.Set(keyring.Item{Key: key, Data: payload}); err != nil {
-		fmt.Fprintf(os.Stderr, "Error storing token: %v\n", err)
+	ring, password, err := rf.open()
+	if err != nil {
+		fail("%v", err)
+	}
+
+	if err := getToken(os.Stdout, ring, password, *email); err != nil {
+		fail("%v", err)
+	}
+}
+
+// getToken writes email's token to w as indented JSON, with the refresh
+// token redacted.
+func getToken(w io.Writer, ring keyring.Keyring, password, email string) error {
+	tok, err := tokenio.Read(ring, password, email)
+	if err != nil {
+		return fmt.Errorf("reading token: %w", err)
+	}
+	tok.RefreshToken = tokenio.Redact(tok.RefreshToken)
+
+	out, err := json.MarshalIndent(tok, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding token: %w", err)
+	}
+	fmt.Fprintln(w, string(out))
+	return nil
+}
+
+func cmdDelete(args []string) {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	rf := addRingFlags(fs)
+	email := fs.String("email", "", "Google account email")
+	fs.Parse(args)
+
+	if *email == "" {
+		fmt.Fprintln(os.Stderr, "Usage: gog-token-sync delete --email user@gmail.com")
 		os.Exit(1)
 	}
 
-	fmt.Printf("✓ Token synced for %s\n", *email)
+	ring, _, err := rf.open()
+	if err != nil {
+		fail("%v", err)
+	}
+
+	if err := tokenio.Delete(ring, *email); err != nil {
+		fail("deleting token: %v", err)
+	}
+	fmt.Printf("✓ Token deleted for %s\n", *email)
+}
+
+func cmdRotate(args []string) {
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	rf := addRingFlags(fs)
+	cf := addCryptFlags(fs)
+	sf := addScopeFlags(fs)
+	email := fs.String("email", "", "Google account email")
+	newRefreshToken := fs.String("new-refresh-token", "", "Replacement OAuth refresh token")
+	fs.Parse(args)
+
+	if *email == "" || *newRefreshToken == "" {
+		fmt.Fprintln(os.Stderr, "Usage: gog-token-sync rotate --email user@gmail.com --new-refresh-token TOKEN")
+		os.Exit(1)
+	}
+
+	ring, password, err := rf.open()
+	if err != nil {
+		fail("%v", err)
+	}
+
+	wantedScopes, err := rotateToken(ring, cf.config(), sf, password, *email, *newRefreshToken)
+	if err != nil {
+		fail("%v", err)
+	}
+	fmt.Printf("✓ Token rotated for %s (scopes: %v)\n", *email, wantedScopes)
+}
+
+// rotateToken replaces email's refresh token with newRefreshToken, carrying
+// its service list forward and recording the replaced token's CreatedAt in
+// RotatedFrom so the rotation history survives the swap.
+func rotateToken(ring keyring.Keyring, crypt tokencrypt.Config, sf *scopeFlags, password, email, newRefreshToken string) ([]string, error) {
+	existing, err := tokenio.Read(ring, password, email)
+	if err != nil {
+		return nil, fmt.Errorf("reading existing token: %w", err)
+	}
+
+	wantedScopes, err := sf.resolve(existing.Services)
+	if err != nil {
+		return nil, err
+	}
+	if err := sf.validate(context.Background(), newRefreshToken, wantedScopes); err != nil {
+		return nil, err
+	}
+
+	err = tokenio.Write(ring, crypt, password, email, token.Token{
+		RefreshToken: newRefreshToken,
+		Services:     existing.Services,
+		Scopes:       wantedScopes,
+		CreatedAt:    time.Now().UTC(),
+		RotatedFrom:  existing.CreatedAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storing rotated token: %w", err)
+	}
+	return wantedScopes, nil
+}
+
+func cmdExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	rf := addRingFlags(fs)
+	format := fs.String("format", "json", "Output format: json or env")
+	fs.Parse(args)
+
+	ring, password, err := rf.open()
+	if err != nil {
+		fail("%v", err)
+	}
+
+	if err := exportTokens(os.Stdout, ring, password, *format); err != nil {
+		fail("%v", err)
+	}
+}
+
+// exportEntry pairs an email with its token for the --format=json output.
+type exportEntry struct {
+	Email string `json:"email"`
+	token.Token
+}
+
+// exportTokens writes every stored token to w as either a JSON array
+// (--format=json) or shell-env assignments (--format=env).
+func exportTokens(w io.Writer, ring keyring.Keyring, password, format string) error {
+	emails, err := tokenio.List(ring)
+	if err != nil {
+		return fmt.Errorf("listing tokens: %w", err)
+	}
+
+	switch format {
+	case "json":
+		entries := make([]exportEntry, 0, len(emails))
+		for _, email := range emails {
+			tok, err := tokenio.Read(ring, password, email)
+			if err != nil {
+				return fmt.Errorf("reading token for %s: %w", email, err)
+			}
+			entries = append(entries, exportEntry{Email: email, Token: tok})
+		}
+		out, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding tokens: %w", err)
+		}
+		fmt.Fprintln(w, string(out))
+	case "env":
+		for _, email := range emails {
+			tok, err := tokenio.Read(ring, password, email)
+			if err != nil {
+				return fmt.Errorf("reading token for %s: %w", email, err)
+			}
+			fmt.Fprintf(w, "# %s\n", email)
+			fmt.Fprintf(w, "GOG_REFRESH_TOKEN=%s\n", tok.RefreshToken)
+		}
+	default:
+		return fmt.Errorf("unknown --format %q (want json or env)", format)
+	}
+	return nil
 }
 
 func splitServices(s string) []string {
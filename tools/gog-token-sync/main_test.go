@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/keyring"
+
+	"github.com/mchatman/aware/internal/token"
+	"github.com/mchatman/aware/internal/tokencrypt"
+	"github.com/mchatman/aware/internal/tokenio"
+)
+
+func legacyPlainConfig() tokencrypt.Config {
+	return tokencrypt.Config{LegacyPlain: true}
+}
+
+func TestSplitServices(t *testing.T) {
+	cases := map[string][]string{
+		"":             nil,
+		"gmail":        {"gmail"},
+		"gmail,drive":  {"gmail", "drive"},
+		"gmail, drive": {"gmail", " drive"},
+		"gmail,,drive": {"gmail", "drive"},
+		",gmail,":      {"gmail"},
+	}
+	for in, want := range cases {
+		got := splitServices(in)
+		if len(got) != len(want) {
+			t.Errorf("splitServices(%q) = %v, want %v", in, got, want)
+			continue
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("splitServices(%q) = %v, want %v", in, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestListTokens(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		if err := tokenio.Write(ring, legacyPlainConfig(), "pw", email, token.Token{RefreshToken: "x"}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := listTokens(&buf, ring); err != nil {
+		t.Fatalf("listTokens: %v", err)
+	}
+
+	// listTokens keeps whatever order the keyring's Keys() returns, which
+	// for ArrayKeyring is unspecified.
+	got := strings.Fields(buf.String())
+	sort.Strings(got)
+	if len(got) != 2 || got[0] != "a@example.com" || got[1] != "b@example.com" {
+		t.Fatalf("got %v, want both emails", got)
+	}
+}
+
+func TestGetToken_RedactsRefreshToken(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	if err := tokenio.Write(ring, legacyPlainConfig(), "pw", "a@example.com", token.Token{RefreshToken: "supersecretvalue"}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := getToken(&buf, ring, "pw", "a@example.com"); err != nil {
+		t.Fatalf("getToken: %v", err)
+	}
+
+	if strings.Contains(buf.String(), "supersecretvalue") {
+		t.Fatalf("output should redact the refresh token, got %s", buf.String())
+	}
+}
+
+func TestRotateToken_PreservesRotatedFrom(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := tokenio.Write(ring, legacyPlainConfig(), "pw", "a@example.com", token.Token{
+		RefreshToken: "old-token",
+		Services:     []string{"drive"},
+		CreatedAt:    created,
+	}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	sf := &scopeFlags{scopesOverride: strPtr(""), skip: boolPtr(true)}
+	if _, err := rotateToken(ring, legacyPlainConfig(), sf, "pw", "a@example.com", "new-token"); err != nil {
+		t.Fatalf("rotateToken: %v", err)
+	}
+
+	got, err := tokenio.Read(ring, "pw", "a@example.com")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if got.RefreshToken != "new-token" {
+		t.Fatalf("got refresh token %q, want %q", got.RefreshToken, "new-token")
+	}
+	if !got.RotatedFrom.Equal(created) {
+		t.Fatalf("got RotatedFrom %v, want %v", got.RotatedFrom, created)
+	}
+}
+
+func TestExportTokens_JSON(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	if err := tokenio.Write(ring, legacyPlainConfig(), "pw", "a@example.com", token.Token{RefreshToken: "rt"}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := exportTokens(&buf, ring, "pw", "json"); err != nil {
+		t.Fatalf("exportTokens: %v", err)
+	}
+
+	var entries []exportEntry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatalf("output isn't valid JSON: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Email != "a@example.com" || entries[0].RefreshToken != "rt" {
+		t.Fatalf("got %+v, want one entry for a@example.com with refresh token rt", entries)
+	}
+}
+
+func TestExportTokens_Env(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	if err := tokenio.Write(ring, legacyPlainConfig(), "pw", "a@example.com", token.Token{RefreshToken: "rt"}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := exportTokens(&buf, ring, "pw", "env"); err != nil {
+		t.Fatalf("exportTokens: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "# a@example.com") || !strings.Contains(out, "GOG_REFRESH_TOKEN=rt") {
+		t.Fatalf("got %q, want a comment header and GOG_REFRESH_TOKEN assignment", out)
+	}
+}
+
+func TestExportTokens_UnknownFormat(t *testing.T) {
+	ring := keyring.NewArrayKeyring(nil)
+	if err := exportTokens(&bytes.Buffer{}, ring, "pw", "xml"); err == nil {
+		t.Fatal("expected an error for an unknown --format")
+	}
+}
+
+func boolPtr(b bool) *bool    { return &b }
+func strPtr(s string) *string { return &s }